@@ -1,107 +1,49 @@
 package main
 
 import (
-	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
+	"os"
 
-	"cosanostra/pkg/models"
-
-	"github.com/gorilla/websocket"
+	"cosanostra/pkg/relay"
+	"cosanostra/pkg/storage"
 )
 
-var upgrader = websocket.Upgrader{
-	CheckOrigin: func(r *http.Request) bool {
-		return true // !!! Allow connections from any origin for now. !!!
-	},
-}
-
-func handleWebSocket(w http.ResponseWriter, r *http.Request) {
-	conn, err := upgrader.Upgrade(w, r, nil)
+func main() {
+	eventStore, err := storage.New(storage.Config{
+		Backend:    os.Getenv("COSANOSTRA_STORAGE_BACKEND"),
+		SQLitePath: os.Getenv("COSANOSTRA_SQLITE_PATH"),
+	})
 	if err != nil {
-		log.Println("Connection upgrade error: ", err)
-		return
+		log.Fatal("Error configuring storage backend: ", err)
 	}
-	defer conn.Close()
-
-	fmt.Println("New client connected!")
-
-	for {
-		_, message, err := conn.ReadMessage()
-		if err != nil {
-			log.Println("Message read error: ", err)
-			break
-		}
-
-		fmt.Printf("Received: %s\n", message)
-
-		// Parse the message as a Nostr protocol message (array format)
-		var rawMessage []json.RawMessage
-		if err := json.Unmarshal(message, &rawMessage); err != nil {
-			errMsg := fmt.Sprintf(`["NOTICE", "Error processing message: invalid JSON: %s"]`, err.Error())
-			conn.WriteMessage(websocket.TextMessage, []byte(errMsg))
-			continue
-		}
-
-		// Ensure we have at least the message type
-		if len(rawMessage) < 1 {
-			conn.WriteMessage(websocket.TextMessage, []byte(`["NOTICE", "Error: Invalid message format"]`))
-			continue
-		}
 
-		// Extract the message type (first element in array)
-		var messageType string
-		if err := json.Unmarshal(rawMessage[0], &messageType); err != nil {
-			conn.WriteMessage(websocket.TextMessage, []byte(`["NOTICE", "Error: Invalid message type"]`))
-			continue
-		}
-
-		// Handle the message based on its type
-		switch messageType {
-		case "EVENT":
-			if len(rawMessage) < 2 {
-				conn.WriteMessage(websocket.TextMessage, []byte(`["NOTICE", "Error: Invalid EVENT message format"]`))
-				continue
-			}
-
-			var event models.Event
-			if err := json.Unmarshal(rawMessage[1], &event); err != nil {
-				errMsg := fmt.Sprintf(`["NOTICE", "Error processing EVENT: %s"]`, err.Error())
-				conn.WriteMessage(websocket.TextMessage, []byte(errMsg))
-				continue
-			}
-
-			// Validate the event
-			if !models.ValidateEvent(&event) {
-				conn.WriteMessage(websocket.TextMessage, []byte(`["NOTICE", "Error processing message: invalid event: ID or signature verification failed"]`))
-				continue
-			}
-
-			// If valid, echo it back as OK for now
-			conn.WriteMessage(websocket.TextMessage, []byte(`["OK", "`+event.ID+`", true, ""]`))
-
-		case "REQ":
-			// Handle subscription requests
-			// For now, just acknowledge it
-			conn.WriteMessage(websocket.TextMessage, []byte(`["NOTICE", "Subscription received but not implemented"]`))
-
-		case "CLOSE":
-			// Handle subscription close
-			conn.WriteMessage(websocket.TextMessage, []byte(`["NOTICE", "Subscription closed"]`))
-
-		default:
-			// Unknown message type
-			errMsg := fmt.Sprintf(`["NOTICE", "Unknown message type: %s"]`, messageType)
-			conn.WriteMessage(websocket.TextMessage, []byte(errMsg))
-		}
+	r := relay.NewRelay(eventStore)
+	r.SetInfo(relay.RelayInfo{
+		Name:          "cosanostra",
+		Description:   "A Nostr relay.",
+		SupportedNIPs: []int{1, 11, 42},
+		Software:      "https://github.com/matk0/cosanostra",
+		Version:       "0.1.0",
+		Limitation: &relay.RelayLimitation{
+			MaxMessageLength: 16384,
+			MaxSubscriptions: 20,
+			MaxFilters:       10,
+			MaxLimit:         500,
+		},
+	})
+
+	// NIP-42 AUTH's "relay" tag check works out of the box by deriving its
+	// expected value from each request's Host (see Relay.expectedURL); set
+	// this explicitly only when running behind a proxy that changes it.
+	if relayURL := os.Getenv("COSANOSTRA_RELAY_URL"); relayURL != "" {
+		r.SetURL(relayURL)
 	}
 
-	fmt.Println("Client disconnected")
-}
+	go r.Run()
 
-func main() {
-	http.HandleFunc("/", handleWebSocket)
+	http.Handle("/", r)
 
 	fmt.Println("COSANOSTRA starting on :3000.")
 	if err := http.ListenAndServe(":3000", nil); err != nil {
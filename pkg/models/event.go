@@ -21,6 +21,12 @@ type Filter struct {
 	Since   int64    `json:"since,omitempty"`
 	Until   int64    `json:"until,omitempty"`
 	Limit   int      `json:"limit,omitempty"`
+	Search  string   `json:"search,omitempty"`
+
+	// Tags holds the generic NIP-01 "#<letter>" tag filters (e.g. "#e",
+	// "#p"), keyed by the letter without its "#" prefix. Populated by
+	// UnmarshalJSON since Go struct tags can't express a wildcard key.
+	Tags map[string][]string `json:"-"`
 }
 
 type Message struct {
@@ -0,0 +1,37 @@
+package models
+
+// Well-known event kinds referenced by kind-semantics handling.
+const (
+	KindMetadata = 0
+	KindContacts = 3
+	KindDeletion = 5
+)
+
+// IsReplaceableKind reports whether the relay should keep only the newest
+// event per (pubkey, kind), per NIP-16.
+func IsReplaceableKind(kind int) bool {
+	return kind == KindMetadata || kind == KindContacts || (kind >= 10000 && kind < 20000)
+}
+
+// IsEphemeralKind reports whether events of this kind should be broadcast
+// to subscribers but never stored, per NIP-16.
+func IsEphemeralKind(kind int) bool {
+	return kind >= 20000 && kind < 30000
+}
+
+// IsParameterizedReplaceableKind reports whether the relay should keep
+// only the newest event per (pubkey, kind, d-tag), per NIP-33.
+func IsParameterizedReplaceableKind(kind int) bool {
+	return kind >= 30000 && kind < 40000
+}
+
+// DTag returns the value of an event's "d" tag, used to key
+// parameterized-replaceable events. Events without one are keyed by "".
+func DTag(event *Event) string {
+	for _, tag := range event.Tags {
+		if len(tag) >= 2 && tag[0] == "d" {
+			return tag[1]
+		}
+	}
+	return ""
+}
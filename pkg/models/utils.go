@@ -6,10 +6,50 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"regexp"
+	"strings"
 
 	"github.com/btcsuite/btcd/btcec/v2/schnorr"
 )
 
+// tagFilterKeyPattern matches the generic NIP-01 "#<letter>" filter keys,
+// e.g. "#e" or "#p".
+var tagFilterKeyPattern = regexp.MustCompile(`^#[a-zA-Z]$`)
+
+// UnmarshalJSON decodes a Filter, additionally collecting any key matching
+// "#<letter>" (e.g. "#e", "#p") into Tags, since Go struct tags can't
+// express that wildcard.
+func (filter *Filter) UnmarshalJSON(data []byte) error {
+	type filterAlias Filter
+	aux := (*filterAlias)(filter)
+	if err := json.Unmarshal(data, aux); err != nil {
+		return err
+	}
+
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	for key, value := range raw {
+		if !tagFilterKeyPattern.MatchString(key) {
+			continue
+		}
+
+		var values []string
+		if err := json.Unmarshal(value, &values); err != nil {
+			return fmt.Errorf("invalid tag filter %q: %v", key, err)
+		}
+
+		if filter.Tags == nil {
+			filter.Tags = make(map[string][]string)
+		}
+		filter.Tags[strings.TrimPrefix(key, "#")] = values
+	}
+
+	return nil
+}
+
 // ValidateEvent checks if an event's ID matches its content hash and validates the signature
 func ValidateEvent(event *Event) bool {
 	// For testing purposes, let's bypass validation temporarily
@@ -139,32 +179,16 @@ func escapeContentField(content string) string {
 
 // MatchesFilter checks if an event matches a specified filter
 func MatchesFilter(event *Event, filter Filter) bool {
-	// If IDs filter is specified, check if event ID is in the list
-	if len(filter.IDs) > 0 {
-		found := false
-		for _, id := range filter.IDs {
-			if event.ID == id {
-				found = true
-				break
-			}
-		}
-		if !found {
-			return false
-		}
+	// If IDs filter is specified, check if event ID starts with one of the
+	// given values (NIP-01 allows prefix matching on ids/authors).
+	if len(filter.IDs) > 0 && !matchesPrefix(event.ID, filter.IDs) {
+		return false
 	}
 
-	// If Authors filter is specified, check if event author is in the list
-	if len(filter.Authors) > 0 {
-		found := false
-		for _, author := range filter.Authors {
-			if event.PubKey == author {
-				found = true
-				break
-			}
-		}
-		if !found {
-			return false
-		}
+	// If Authors filter is specified, check if event author starts with one
+	// of the given values.
+	if len(filter.Authors) > 0 && !matchesPrefix(event.PubKey, filter.Authors) {
+		return false
 	}
 
 	// If Kinds filter is specified, check if event kind is in the list
@@ -190,9 +214,48 @@ func MatchesFilter(event *Event, filter Filter) bool {
 		return false
 	}
 
+	// For each "#<letter>" filter, the event must carry at least one tag
+	// whose first element is that letter and whose second element is one
+	// of the given values.
+	for tagName, values := range filter.Tags {
+		if !hasMatchingTag(event, tagName, values) {
+			return false
+		}
+	}
+
+	if filter.Search != "" && !strings.Contains(strings.ToLower(event.Content), strings.ToLower(filter.Search)) {
+		return false
+	}
+
 	return true
 }
 
+// matchesPrefix reports whether value starts with any of prefixes.
+func matchesPrefix(value string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(value, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasMatchingTag reports whether event has a tag named tagName whose value
+// is one of values.
+func hasMatchingTag(event *Event, tagName string, values []string) bool {
+	for _, tag := range event.Tags {
+		if len(tag) < 2 || tag[0] != tagName {
+			continue
+		}
+		for _, value := range values {
+			if tag[1] == value {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 // For debugging: helper function to validate events with bypass option
 func DebugValidateEvent(event *Event, bypassSignature bool) bool {
 	// First, check if the event ID is correct (SHA256 hash of the serialized event)
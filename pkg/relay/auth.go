@@ -0,0 +1,124 @@
+// pkg/relay/auth.go
+package relay
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"cosanostra/pkg/models"
+)
+
+// authEventKind is the kind of the ephemeral "AUTH" event clients sign in
+// response to our challenge, per NIP-42.
+const authEventKind = 22242
+
+// authTimestampSkew is how far a signed AUTH event's created_at may drift
+// from now before we reject it.
+const authTimestampSkew = 10 * time.Minute
+
+// newChallenge generates a fresh per-connection NIP-42 challenge: 8 random
+// bytes, hex-encoded.
+func newChallenge() (string, error) {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// sendAuthChallenge issues the relay's AUTH challenge to a freshly
+// connected client, as khatru's HandleWebsocket does before entering its
+// read loop.
+func (relay *Relay) sendAuthChallenge(client *Client) error {
+	challenge, err := newChallenge()
+	if err != nil {
+		return fmt.Errorf("failed to generate auth challenge: %v", err)
+	}
+	client.challenge = challenge
+
+	authResponse := []interface{}{"AUTH", challenge}
+	jsonAuthResponse, err := json.Marshal(authResponse)
+	if err != nil {
+		return fmt.Errorf("failed to marshal auth challenge: %v", err)
+	}
+
+	client.enqueue(jsonAuthResponse)
+	return nil
+}
+
+// handleAuthMessage processes AUTH messages, verifying the signed kind-22242
+// event against the challenge we issued this client and recording the
+// authenticated pubkey on success.
+func (relay *Relay) handleAuthMessage(client *Client, rawMessage []json.RawMessage) error {
+	if len(rawMessage) < 2 {
+		return fmt.Errorf("invalid AUTH message")
+	}
+
+	var event models.Event
+	if err := json.Unmarshal(rawMessage[1], &event); err != nil {
+		return fmt.Errorf("invalid auth event data: %v", err)
+	}
+
+	if err := relay.verifyAuthEvent(client, &event); err != nil {
+		return relay.sendOK(client, event.ID, false, "auth-required: "+err.Error())
+	}
+
+	client.authedPubkey = event.PubKey
+
+	return relay.sendOK(client, event.ID, true, "")
+}
+
+// verifyAuthEvent checks a signed AUTH event against NIP-42: it must be a
+// valid kind-22242 event, carry a "challenge" tag matching the one we
+// issued this client, and be recent.
+func (relay *Relay) verifyAuthEvent(client *Client, event *models.Event) error {
+	if client.challenge == "" {
+		return fmt.Errorf("no challenge issued for this connection")
+	}
+
+	if event.Kind != authEventKind {
+		return fmt.Errorf("invalid auth event kind: %d", event.Kind)
+	}
+
+	if !models.ValidateEvent(event) {
+		return fmt.Errorf("invalid event: ID or signature verification failed")
+	}
+
+	skew := time.Since(time.Unix(event.CreatedAt, 0))
+	if skew < -authTimestampSkew || skew > authTimestampSkew {
+		return fmt.Errorf("auth event created_at is too far from now")
+	}
+
+	var hasRelayTag, hasChallengeTag bool
+	for _, tag := range event.Tags {
+		if len(tag) < 2 {
+			continue
+		}
+		switch tag[0] {
+		case "relay":
+			// client.expectedRelayURL is either the operator-configured
+			// relay.url (see SetURL) or one derived from the request the
+			// client connected with (see Relay.expectedURL), so this check
+			// is meaningful without any required configuration.
+			if tag[1] == client.expectedRelayURL {
+				hasRelayTag = true
+			}
+		case "challenge":
+			if tag[1] == client.challenge {
+				hasChallengeTag = true
+			}
+		}
+	}
+
+	if !hasRelayTag {
+		return fmt.Errorf("auth event missing matching \"relay\" tag")
+	}
+	if !hasChallengeTag {
+		return fmt.Errorf("auth event missing matching \"challenge\" tag")
+	}
+
+	return nil
+}
@@ -0,0 +1,112 @@
+package relay
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/gorilla/websocket"
+
+	"cosanostra/pkg/models"
+	"cosanostra/pkg/storage"
+)
+
+// signEvent fills in event.ID, event.PubKey and event.Sig for a NIP-01
+// event signed by a freshly generated private key.
+func signEvent(t *testing.T, event *models.Event) {
+	t.Helper()
+
+	privKey, err := btcec.NewPrivateKey()
+	if err != nil {
+		t.Fatalf("NewPrivateKey: %v", err)
+	}
+	pubKeyBytes := schnorr.SerializePubKey(privKey.PubKey())
+	event.PubKey = hex.EncodeToString(pubKeyBytes)
+
+	serialized, err := models.SerializeEvent(event)
+	if err != nil {
+		t.Fatalf("SerializeEvent: %v", err)
+	}
+	hash := sha256.Sum256([]byte(serialized))
+	event.ID = hex.EncodeToString(hash[:])
+
+	sig, err := schnorr.Sign(privKey, hash[:])
+	if err != nil {
+		t.Fatalf("schnorr.Sign: %v", err)
+	}
+	event.Sig = hex.EncodeToString(sig.Serialize())
+}
+
+// TestAuthDefaultRelayURLFromRequest verifies that NIP-42 AUTH succeeds
+// against the relay's default, request-derived expected URL when the
+// operator hasn't called SetURL - the check must be satisfiable without
+// any configuration, not just fail closed.
+func TestAuthDefaultRelayURLFromRequest(t *testing.T) {
+	r := NewRelay(storage.NewEventStore())
+	r.SetInfo(RelayInfo{Name: "smoke"})
+	go r.Run()
+
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	wsURL := "ws" + server.URL[len("http"):]
+	expectedRelayURL := "ws://" + server.URL[len("http://"):]
+
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, http.Header{})
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+
+	_, challengeMsg, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("read auth challenge: %v", err)
+	}
+
+	var parsed []interface{}
+	if err := json.Unmarshal(challengeMsg, &parsed); err != nil {
+		t.Fatalf("unmarshal auth challenge: %v", err)
+	}
+	challenge, _ := parsed[1].(string)
+	if challenge == "" {
+		t.Fatalf("empty challenge in %s", challengeMsg)
+	}
+
+	event := &models.Event{
+		Kind:      authEventKind,
+		CreatedAt: time.Now().Unix(),
+		Tags: [][]string{
+			{"relay", expectedRelayURL},
+			{"challenge", challenge},
+		},
+	}
+	signEvent(t, event)
+
+	authMsg, err := json.Marshal([]interface{}{"AUTH", event})
+	if err != nil {
+		t.Fatalf("marshal AUTH: %v", err)
+	}
+	if err := conn.WriteMessage(websocket.TextMessage, authMsg); err != nil {
+		t.Fatalf("write AUTH: %v", err)
+	}
+
+	_, okMsg, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("read OK: %v", err)
+	}
+
+	var okParsed []interface{}
+	if err := json.Unmarshal(okMsg, &okParsed); err != nil {
+		t.Fatalf("unmarshal OK: %v", err)
+	}
+	ok, _ := okParsed[2].(bool)
+	if !ok {
+		t.Fatalf("AUTH was not accepted against the default request-derived relay URL: %s", okMsg)
+	}
+}
@@ -0,0 +1,87 @@
+package relay
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"cosanostra/pkg/models"
+	"cosanostra/pkg/storage"
+)
+
+// TestBroadcastVsDisconnect exercises BroadcastEvent racing client
+// disconnects: some clients subscribe then immediately close their
+// connection, while other goroutines keep calling BroadcastEvent. Run with
+// -race, this catches the send-on-a-closed-channel panic that a bare
+// close(client.send) in Run's unregister branch used to cause whenever a
+// disconnect landed between BroadcastEvent's client-list snapshot and its
+// enqueue call for that client.
+func TestBroadcastVsDisconnect(t *testing.T) {
+	r := NewRelay(storage.NewEventStore())
+	r.SetInfo(RelayInfo{Name: "smoke"})
+	go r.Run()
+
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	wsURL := "ws" + server.URL[len("http"):]
+
+	const numClients = 8
+	conns := make([]*websocket.Conn, numClients)
+	for i := 0; i < numClients; i++ {
+		conn, _, err := websocket.DefaultDialer.Dial(wsURL, http.Header{})
+		if err != nil {
+			t.Fatalf("dial %d: %v", i, err)
+		}
+		conns[i] = conn
+
+		if _, _, err := conn.ReadMessage(); err != nil { // AUTH challenge
+			t.Fatalf("read auth challenge %d: %v", i, err)
+		}
+
+		if err := conn.WriteMessage(websocket.TextMessage, []byte(`["REQ","sub1",{}]`)); err != nil {
+			t.Fatalf("write REQ %d: %v", i, err)
+		}
+		if _, _, err := conn.ReadMessage(); err != nil { // EOSE
+			t.Fatalf("read EOSE %d: %v", i, err)
+		}
+	}
+
+	var wg sync.WaitGroup
+
+	// Half the clients disconnect mid-flight, racing against broadcasts.
+	for i := 0; i < numClients/2; i++ {
+		conn := conns[i]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			conn.Close()
+		}()
+	}
+	for i := numClients / 2; i < numClients; i++ {
+		defer conns[i].Close()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		for j := 0; j < 200; j++ {
+			r.BroadcastEvent(&models.Event{
+				ID:        "deadbeef",
+				Kind:      1,
+				CreatedAt: time.Now().Unix(),
+			})
+		}
+		close(done)
+	}()
+
+	wg.Wait()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("broadcast loop did not finish in time")
+	}
+}
@@ -2,11 +2,29 @@
 package relay
 
 import (
+	"log"
+	"sync"
+	"time"
+
 	"github.com/gorilla/websocket"
 
 	"cosanostra/pkg/models"
 )
 
+const (
+	// writeWait is how long a single write to the connection may take.
+	writeWait = 10 * time.Second
+	// pongWait is how long we wait for a pong before considering the
+	// connection dead.
+	pongWait = 60 * time.Second
+	// PingPeriod is how often we ping the client; must be less than
+	// pongWait.
+	PingPeriod = (pongWait * 9) / 10
+	// sendBufferSize is how many outgoing messages a client may have
+	// queued before it's considered too slow and disconnected.
+	sendBufferSize = 256
+)
+
 // Subscription represents a client subscription
 type Subscription struct {
 	ID      string
@@ -18,15 +36,40 @@ type Subscription struct {
 type Client struct {
 	conn          *websocket.Conn
 	subscriptions map[string]*Subscription
+	subMutex      sync.RWMutex
 	relay         *Relay // This will be a circular reference
+
+	// send is the client's outgoing message queue. A dedicated writer
+	// goroutine (writePump) is the only thing that ever writes to conn,
+	// which serializes writes and keeps one slow reader from blocking
+	// writes meant for everybody else.
+	send chan []byte
+
+	// sendMu guards closed and send's close-once semantics. enqueue and
+	// closeSend both take it, so a broadcast racing a disconnect can never
+	// send on a channel that close() has already touched.
+	sendMu sync.Mutex
+	closed bool
+
+	challenge        string // NIP-42 challenge issued to this connection
+	authedPubkey     string // pubkey authenticated via NIP-42 AUTH, empty until then
+	expectedRelayURL string // value this client's AUTH "relay" tag must match, see Relay.expectedURL
+}
+
+// Authenticated reports whether this client has completed NIP-42 AUTH.
+func (client *Client) Authenticated() bool {
+	return client.authedPubkey != ""
 }
 
-// NewClient creates a new client
-func NewClient(conn *websocket.Conn, relay *Relay) *Client {
+// NewClient creates a new client. expectedRelayURL is the value this
+// client's NIP-42 AUTH "relay" tag must match, see Relay.expectedURL.
+func NewClient(conn *websocket.Conn, relay *Relay, expectedRelayURL string) *Client {
 	return &Client{
-		conn:          conn,
-		subscriptions: make(map[string]*Subscription),
-		relay:         relay,
+		conn:             conn,
+		subscriptions:    make(map[string]*Subscription),
+		relay:            relay,
+		send:             make(chan []byte, sendBufferSize),
+		expectedRelayURL: expectedRelayURL,
 	}
 }
 
@@ -38,11 +81,101 @@ func (client *Client) AddSubscription(id string, filters []models.Filter) *Subsc
 		Client:  client,
 	}
 
+	client.subMutex.Lock()
+	defer client.subMutex.Unlock()
+
 	client.subscriptions[id] = subscription
 	return subscription
 }
 
 // RemoveSubscription removes a subscription by ID
 func (client *Client) RemoveSubscription(id string) {
+	client.subMutex.Lock()
+	defer client.subMutex.Unlock()
+
 	delete(client.subscriptions, id)
 }
+
+// subscriptionsSnapshot returns a point-in-time copy of this client's
+// subscriptions, safe to range over without holding subMutex.
+func (client *Client) subscriptionsSnapshot() []*Subscription {
+	client.subMutex.RLock()
+	defer client.subMutex.RUnlock()
+
+	subs := make([]*Subscription, 0, len(client.subscriptions))
+	for _, sub := range client.subscriptions {
+		subs = append(subs, sub)
+	}
+	return subs
+}
+
+// enqueue queues message for delivery by this client's writer goroutine,
+// without blocking the caller. A client whose send buffer is full is too
+// slow to keep up and is disconnected instead of stalling whoever is
+// broadcasting to it. enqueue is a no-op once the client has disconnected,
+// so callers never race closeSend's close(client.send).
+func (client *Client) enqueue(message []byte) {
+	client.sendMu.Lock()
+	defer client.sendMu.Unlock()
+
+	if client.closed {
+		return
+	}
+
+	select {
+	case client.send <- message:
+	default:
+		log.Println("Client send buffer full, disconnecting")
+		client.closeSendLocked()
+		client.conn.Close()
+	}
+}
+
+// closeSend closes the client's send channel exactly once, waking
+// writePump. Safe to call from any goroutine, any number of times.
+func (client *Client) closeSend() {
+	client.sendMu.Lock()
+	defer client.sendMu.Unlock()
+
+	client.closeSendLocked()
+}
+
+func (client *Client) closeSendLocked() {
+	if !client.closed {
+		client.closed = true
+		close(client.send)
+	}
+}
+
+// writePump serializes all writes to the client's connection: queued
+// messages, periodic pings, and the close handshake. It owns conn's write
+// side for the lifetime of the connection and must be the only goroutine
+// writing to it.
+func (client *Client) writePump() {
+	ticker := time.NewTicker(PingPeriod)
+	defer func() {
+		ticker.Stop()
+		client.conn.Close()
+	}()
+
+	for {
+		select {
+		case message, ok := <-client.send:
+			client.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if !ok {
+				client.conn.WriteMessage(websocket.CloseMessage, []byte{})
+				return
+			}
+
+			if err := client.conn.WriteMessage(websocket.TextMessage, message); err != nil {
+				return
+			}
+
+		case <-ticker.C:
+			client.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := client.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,32 @@
+// pkg/relay/info.go
+package relay
+
+// RelayInfo describes the relay for NIP-11 clients. Operators populate it
+// at startup via SetInfo; zero-valued fields are simply omitted by the
+// JSON encoder.
+type RelayInfo struct {
+	Name          string           `json:"name,omitempty"`
+	Description   string           `json:"description,omitempty"`
+	PubKey        string           `json:"pubkey,omitempty"`
+	Contact       string           `json:"contact,omitempty"`
+	SupportedNIPs []int            `json:"supported_nips,omitempty"`
+	Software      string           `json:"software,omitempty"`
+	Version       string           `json:"version,omitempty"`
+	Limitation    *RelayLimitation `json:"limitation,omitempty"`
+}
+
+// RelayLimitation describes operational limits advertised to clients, as
+// specified by NIP-11. The relay publishes these values in its information
+// document only; it does not enforce them.
+type RelayLimitation struct {
+	MaxMessageLength int `json:"max_message_length,omitempty"`
+	MaxSubscriptions int `json:"max_subscriptions,omitempty"`
+	MaxFilters       int `json:"max_filters,omitempty"`
+	MaxLimit         int `json:"max_limit,omitempty"`
+}
+
+// SetInfo configures the NIP-11 relay information document returned to
+// clients that request it with Accept: application/nostr+json.
+func (relay *Relay) SetInfo(info RelayInfo) {
+	relay.info = info
+}
@@ -0,0 +1,70 @@
+// pkg/relay/kinds.go
+package relay
+
+import "cosanostra/pkg/models"
+
+// applyReplaceableSemantics enforces NIP-16 (kind-scoped) and NIP-33
+// (kind+d-tag-scoped) replacement: it deletes any previously stored events
+// that event supersedes. It returns false if a newer replacement already
+// exists, in which case event should be discarded rather than stored.
+func (relay *Relay) applyReplaceableSemantics(event *models.Event) bool {
+	existing := relay.eventStore.Query(models.Filter{
+		Authors: []string{event.PubKey},
+		Kinds:   []int{event.Kind},
+	})
+
+	parameterized := models.IsParameterizedReplaceableKind(event.Kind)
+	dTag := ""
+	if parameterized {
+		dTag = models.DTag(event)
+	}
+
+	sameScope := func(old *models.Event) bool {
+		if old.ID == event.ID {
+			return false
+		}
+		return !parameterized || models.DTag(old) == dTag
+	}
+
+	for _, old := range existing {
+		if !sameScope(old) {
+			continue
+		}
+		if old.CreatedAt > event.CreatedAt || (old.CreatedAt == event.CreatedAt && old.ID < event.ID) {
+			return false
+		}
+	}
+
+	for _, old := range existing {
+		if sameScope(old) {
+			relay.eventStore.Delete(old.ID)
+		}
+	}
+
+	return true
+}
+
+// handleDeletionEvent processes a NIP-09 kind-5 deletion request: for each
+// "e" tag, the referenced event is deleted if it was authored by the same
+// pubkey, and blocked from ever being re-accepted.
+func (relay *Relay) handleDeletionEvent(client *Client, event *models.Event) error {
+	for _, tag := range event.Tags {
+		if len(tag) < 2 || tag[0] != "e" {
+			continue
+		}
+
+		targetID := tag[1]
+		target, ok := relay.eventStore.GetByID(targetID)
+		if !ok || target.PubKey != event.PubKey {
+			continue
+		}
+
+		relay.eventStore.Delete(targetID)
+		relay.eventStore.MarkDeleted(targetID)
+	}
+
+	relay.eventStore.Add(event)
+	relay.BroadcastEvent(event)
+
+	return relay.sendOK(client, event.ID, true, "")
+}
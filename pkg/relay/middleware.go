@@ -0,0 +1,161 @@
+// pkg/relay/middleware.go
+package relay
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"cosanostra/pkg/models"
+)
+
+// RateLimiter enforces a simple per-IP token bucket, used to build
+// RejectEvent/RejectFilter middleware: each IP starts with burst tokens and
+// refills at rate tokens/sec, so occasional bursts are allowed but sustained
+// abuse is throttled.
+type RateLimiter struct {
+	rate  float64
+	burst float64
+
+	mutex   sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+type tokenBucket struct {
+	tokens   float64
+	lastSeen time.Time
+}
+
+// NewRateLimiter creates a rate limiter allowing burst messages immediately
+// per IP, refilling at rate messages/sec after that.
+func NewRateLimiter(rate, burst float64) *RateLimiter {
+	return &RateLimiter{
+		rate:    rate,
+		burst:   burst,
+		buckets: make(map[string]*tokenBucket),
+	}
+}
+
+func (limiter *RateLimiter) allow(ip string) bool {
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+
+	now := time.Now()
+	bucket, ok := limiter.buckets[ip]
+	if !ok {
+		bucket = &tokenBucket{tokens: limiter.burst, lastSeen: now}
+		limiter.buckets[ip] = bucket
+	}
+
+	elapsed := now.Sub(bucket.lastSeen).Seconds()
+	bucket.tokens = min(limiter.burst, bucket.tokens+elapsed*limiter.rate)
+	bucket.lastSeen = now
+
+	if bucket.tokens < 1 {
+		return false
+	}
+	bucket.tokens--
+	return true
+}
+
+// RejectEvent is a RejectEventFunc rejecting EVENT messages from IPs over
+// their rate limit.
+func (limiter *RateLimiter) RejectEvent(client *Client, event *models.Event) (bool, string) {
+	if !limiter.allow(clientIP(client)) {
+		return true, "rate-limited: slow down"
+	}
+	return false, ""
+}
+
+// RejectFilter is a RejectFilterFunc rejecting REQ messages from IPs over
+// their rate limit.
+func (limiter *RateLimiter) RejectFilter(client *Client, filter *models.Filter) (bool, string) {
+	if !limiter.allow(clientIP(client)) {
+		return true, "rate-limited: slow down"
+	}
+	return false, ""
+}
+
+// clientIP returns the connecting IP for client, stripped of its port.
+func clientIP(client *Client) string {
+	addr := client.conn.RemoteAddr().String()
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
+
+// ProofOfWork returns a RejectEventFunc enforcing a NIP-13 minimum
+// difficulty: the event ID must have at least minDifficulty leading zero
+// bits and, if requireNonceTag is set, carry a "nonce" tag.
+func ProofOfWork(minDifficulty int, requireNonceTag bool) RejectEventFunc {
+	return func(client *Client, event *models.Event) (bool, string) {
+		if requireNonceTag && !hasNonceTag(event) {
+			return true, "pow: missing nonce tag"
+		}
+
+		if difficulty := leadingZeroBits(event.ID); difficulty < minDifficulty {
+			return true, fmt.Sprintf("pow: difficulty %d is less than %d", difficulty, minDifficulty)
+		}
+
+		return false, ""
+	}
+}
+
+func hasNonceTag(event *models.Event) bool {
+	for _, tag := range event.Tags {
+		if len(tag) >= 1 && tag[0] == "nonce" {
+			return true
+		}
+	}
+	return false
+}
+
+// leadingZeroBits counts the leading zero bits of a hex-encoded ID, per
+// NIP-13.
+func leadingZeroBits(hexID string) int {
+	count := 0
+	for _, c := range hexID {
+		nibble, err := strconv.ParseUint(string(c), 16, 8)
+		if err != nil {
+			break
+		}
+		if nibble == 0 {
+			count += 4
+			continue
+		}
+		for bit := 3; bit >= 0; bit-- {
+			if nibble&(1<<uint(bit)) != 0 {
+				return count
+			}
+			count++
+		}
+		break
+	}
+	return count
+}
+
+// MaxContentLength returns a RejectEventFunc rejecting events whose content
+// exceeds maxLen bytes.
+func MaxContentLength(maxLen int) RejectEventFunc {
+	return func(client *Client, event *models.Event) (bool, string) {
+		if len(event.Content) > maxLen {
+			return true, fmt.Sprintf("invalid: content exceeds %d bytes", maxLen)
+		}
+		return false, ""
+	}
+}
+
+// MaxTagCount returns a RejectEventFunc rejecting events with more than
+// maxTags tags.
+func MaxTagCount(maxTags int) RejectEventFunc {
+	return func(client *Client, event *models.Event) (bool, string) {
+		if len(event.Tags) > maxTags {
+			return true, fmt.Sprintf("invalid: too many tags (max %d)", maxTags)
+		}
+		return false, ""
+	}
+}
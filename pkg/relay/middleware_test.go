@@ -0,0 +1,56 @@
+package relay
+
+import (
+	"testing"
+
+	"cosanostra/pkg/models"
+)
+
+func TestRateLimiterAllowsBurstThenThrottles(t *testing.T) {
+	limiter := NewRateLimiter(0, 2) // no refill, so only the burst goes through
+
+	for i := 0; i < 2; i++ {
+		if !limiter.allow("1.2.3.4") {
+			t.Fatalf("allow() #%d rejected within burst", i)
+		}
+	}
+
+	if limiter.allow("1.2.3.4") {
+		t.Fatal("allow() did not reject once the burst was exhausted")
+	}
+
+	if !limiter.allow("5.6.7.8") {
+		t.Fatal("allow() rejected a different IP that hasn't used its burst")
+	}
+}
+
+func TestProofOfWorkThreshold(t *testing.T) {
+	reject := ProofOfWork(8, false)
+
+	lowDifficulty := &models.Event{ID: "ff00000000000000000000000000000000000000000000000000000000000000"}
+	if ok, msg := reject(nil, lowDifficulty); !ok {
+		t.Fatalf("ProofOfWork(8) accepted a 0-bit-difficulty ID: %s", msg)
+	}
+
+	highDifficulty := &models.Event{ID: "00ff000000000000000000000000000000000000000000000000000000000000"}
+	if ok, msg := reject(nil, highDifficulty); ok {
+		t.Fatalf("ProofOfWork(8) rejected an 8-bit-difficulty ID: %s", msg)
+	}
+}
+
+func TestProofOfWorkRequiresNonceTag(t *testing.T) {
+	reject := ProofOfWork(0, true)
+
+	withoutNonce := &models.Event{ID: "00ff000000000000000000000000000000000000000000000000000000000000"}
+	if ok, msg := reject(nil, withoutNonce); !ok {
+		t.Fatalf("ProofOfWork with requireNonceTag accepted an event without a nonce tag: %s", msg)
+	}
+
+	withNonce := &models.Event{
+		ID:   "00ff000000000000000000000000000000000000000000000000000000000000",
+		Tags: [][]string{{"nonce", "1", "8"}},
+	}
+	if ok, msg := reject(nil, withNonce); ok {
+		t.Fatalf("ProofOfWork with requireNonceTag rejected an event that has a nonce tag: %s", msg)
+	}
+}
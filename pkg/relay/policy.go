@@ -0,0 +1,68 @@
+// pkg/relay/policy.go
+package relay
+
+import (
+	"net/http"
+
+	"cosanostra/pkg/models"
+)
+
+// RejectConnectionFunc decides whether to refuse an incoming HTTP request
+// before it's upgraded to a WebSocket connection.
+type RejectConnectionFunc func(r *http.Request) bool
+
+// RejectEventFunc decides whether to reject an incoming EVENT, in the
+// context of the client that sent it, returning a human-readable reason to
+// surface in the OK response when it does.
+type RejectEventFunc func(client *Client, event *models.Event) (reject bool, msg string)
+
+// RejectFilterFunc decides whether to reject an incoming REQ filter, in the
+// context of the client that sent it, returning a human-readable reason to
+// surface in the CLOSED response when it does.
+type RejectFilterFunc func(client *Client, filter *models.Filter) (reject bool, msg string)
+
+// OverwriteResponseEventFunc lets a middleware rewrite an event immediately
+// before it's sent to a particular client, e.g. to redact fields.
+type OverwriteResponseEventFunc func(client *Client, event *models.Event) *models.Event
+
+// runRejectConnection reports whether any RejectConnection middleware
+// rejects r.
+func (relay *Relay) runRejectConnection(r *http.Request) bool {
+	for _, reject := range relay.RejectConnection {
+		if reject(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// runRejectEvent runs the RejectEvent chain, returning the first rejection
+// reason encountered, if any.
+func (relay *Relay) runRejectEvent(client *Client, event *models.Event) (bool, string) {
+	for _, reject := range relay.RejectEvent {
+		if ok, msg := reject(client, event); ok {
+			return true, msg
+		}
+	}
+	return false, ""
+}
+
+// runRejectFilter runs the RejectFilter chain, returning the first
+// rejection reason encountered, if any.
+func (relay *Relay) runRejectFilter(client *Client, filter *models.Filter) (bool, string) {
+	for _, reject := range relay.RejectFilter {
+		if ok, msg := reject(client, filter); ok {
+			return true, msg
+		}
+	}
+	return false, ""
+}
+
+// applyOverwriteResponseEvent runs the OverwriteResponseEvent chain over
+// event before it's sent to client.
+func (relay *Relay) applyOverwriteResponseEvent(client *Client, event *models.Event) *models.Event {
+	for _, overwrite := range relay.OverwriteResponseEvent {
+		event = overwrite(client, event)
+	}
+	return event
+}
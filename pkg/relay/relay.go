@@ -5,7 +5,11 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"net/http"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/gorilla/websocket"
 
@@ -13,25 +17,110 @@ import (
 	"cosanostra/pkg/storage"
 )
 
+// upgrader upgrades incoming HTTP requests to WebSocket connections for
+// clients that aren't asking for the NIP-11 relay information document.
+var upgrader = websocket.Upgrader{
+	CheckOrigin: func(r *http.Request) bool {
+		return true // !!! Allow connections from any origin for now. !!!
+	},
+}
+
 // Relay is the central structure of our Nostr relay
 type Relay struct {
 	clients    map[*Client]bool
-	eventStore *storage.EventStore
+	eventStore storage.Storage
 	register   chan *Client
 	unregister chan *Client
 	mutex      sync.Mutex
+	info       RelayInfo
+	url        string // this relay's own URL, checked against NIP-42 "relay" tags
+
+	// RequireAuthForRead rejects REQ messages from clients that have not
+	// completed NIP-42 AUTH.
+	RequireAuthForRead bool
+	// RequireAuthForWrite rejects EVENT messages from clients that have not
+	// completed NIP-42 AUTH.
+	RequireAuthForWrite bool
+
+	// RejectConnection, RejectEvent, RejectFilter and OverwriteResponseEvent
+	// form a pluggable middleware pipeline, run in order, that operators can
+	// append to for rate limiting, proof-of-work, content filtering, etc.
+	RejectConnection       []RejectConnectionFunc
+	RejectEvent            []RejectEventFunc
+	RejectFilter           []RejectFilterFunc
+	OverwriteResponseEvent []OverwriteResponseEventFunc
 }
 
-// NewRelay creates a new relay instance
-func NewRelay() *Relay {
+// NewRelay creates a new relay instance backed by the given storage. Use
+// storage.New to select a backend via config, or storage.NewEventStore()
+// directly for the in-memory default.
+func NewRelay(eventStore storage.Storage) *Relay {
 	return &Relay{
 		clients:    make(map[*Client]bool),
-		eventStore: storage.NewEventStore(),
+		eventStore: eventStore,
 		register:   make(chan *Client),
 		unregister: make(chan *Client),
 	}
 }
 
+// ServeHTTP serves both the WebSocket endpoint and the NIP-11 relay
+// information document on the same route, branching the way khatru's
+// ServeHTTP does: anything carrying an "Upgrade: websocket" header is
+// treated as a WebSocket handshake, otherwise a request with
+// Accept: application/nostr+json gets the info document.
+func (relay *Relay) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if relay.runRejectConnection(r) {
+		http.Error(w, "connection rejected", http.StatusForbidden)
+		return
+	}
+
+	if strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			log.Println("Connection upgrade error:", err)
+			return
+		}
+
+		relay.HandleConnection(conn, relay.expectedURL(r))
+		return
+	}
+
+	if r.Header.Get("Accept") == "application/nostr+json" {
+		w.Header().Set("Content-Type", "application/nostr+json")
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		if err := json.NewEncoder(w).Encode(relay.info); err != nil {
+			log.Println("Error encoding relay info document:", err)
+		}
+		return
+	}
+
+	http.Error(w, "this relay only speaks the Nostr WebSocket protocol, try Accept: application/nostr+json", http.StatusUpgradeRequired)
+}
+
+// SetURL configures the relay's own URL, used to validate the "relay" tag
+// on NIP-42 AUTH events. Operators behind a reverse proxy or a hostname
+// that doesn't match what clients connect to should set this explicitly;
+// otherwise expectedURL derives a default per-request from r.Host.
+func (relay *Relay) SetURL(url string) {
+	relay.url = url
+}
+
+// expectedURL returns the relay URL a client connecting via r should put in
+// its NIP-42 AUTH "relay" tag: the operator-configured URL if one was set
+// via SetURL, otherwise one derived from the request itself, as khatru's
+// default NIP-42 handling does.
+func (relay *Relay) expectedURL(r *http.Request) string {
+	if relay.url != "" {
+		return relay.url
+	}
+
+	scheme := "ws"
+	if r.TLS != nil {
+		scheme = "wss"
+	}
+	return scheme + "://" + r.Host
+}
+
 // Run starts the relay's main loop
 func (relay *Relay) Run() {
 	for {
@@ -44,18 +133,20 @@ func (relay *Relay) Run() {
 
 		case client := <-relay.unregister:
 			relay.mutex.Lock()
-			if _, ok := relay.clients[client]; ok {
-				delete(relay.clients, client)
-			}
+			delete(relay.clients, client)
 			relay.mutex.Unlock()
+			client.closeSend()
 			log.Println("Client unregistered, total clients:", len(relay.clients))
 		}
 	}
 }
 
-// HandleConnection manages a client WebSocket connection
-func (relay *Relay) HandleConnection(conn *websocket.Conn) {
-	client := NewClient(conn, relay)
+// HandleConnection manages a client WebSocket connection. The connection's
+// write side belongs entirely to client.writePump, running in its own
+// goroutine; this goroutine only ever reads. expectedRelayURL is the value
+// this client's NIP-42 AUTH "relay" tag must match (see expectedURL).
+func (relay *Relay) HandleConnection(conn *websocket.Conn, expectedRelayURL string) {
+	client := NewClient(conn, relay, expectedRelayURL)
 
 	relay.register <- client
 	defer func() {
@@ -63,6 +154,19 @@ func (relay *Relay) HandleConnection(conn *websocket.Conn) {
 		conn.Close()
 	}()
 
+	go client.writePump()
+
+	conn.SetReadDeadline(time.Now().Add(pongWait))
+	conn.SetPongHandler(func(string) error {
+		conn.SetReadDeadline(time.Now().Add(pongWait))
+		return nil
+	})
+
+	if err := relay.sendAuthChallenge(client); err != nil {
+		log.Println("Failed to send auth challenge:", err)
+		return
+	}
+
 	for {
 		_, message, err := conn.ReadMessage()
 		if err != nil {
@@ -72,31 +176,42 @@ func (relay *Relay) HandleConnection(conn *websocket.Conn) {
 
 		if err := relay.handleMessage(client, message); err != nil {
 			log.Println("Handle message error:", err)
-			// Optionally send error to client
 			errResponse := []interface{}{"NOTICE", "Error processing message: " + err.Error()}
-			jsonErrResponse, _ := json.Marshal(errResponse)
-			conn.WriteMessage(websocket.TextMessage, jsonErrResponse)
+			jsonErrResponse, err := json.Marshal(errResponse)
+			if err != nil {
+				log.Println("Error marshaling NOTICE:", err)
+				continue
+			}
+			client.enqueue(jsonErrResponse)
 		}
 	}
 }
 
-// BroadcastEvent sends an event to all clients with matching subscriptions
+// BroadcastEvent sends an event to all clients with matching subscriptions.
+// It snapshots the client list under relay.mutex, then matches filters and
+// enqueues sends without holding the lock, so one slow client can't stall
+// delivery to everybody else.
 func (relay *Relay) BroadcastEvent(event *models.Event) {
 	relay.mutex.Lock()
-	defer relay.mutex.Unlock()
-
+	clients := make([]*Client, 0, len(relay.clients))
 	for client := range relay.clients {
-		for subID, sub := range client.subscriptions {
+		clients = append(clients, client)
+	}
+	relay.mutex.Unlock()
+
+	for _, client := range clients {
+		for _, sub := range client.subscriptionsSnapshot() {
 			for _, filter := range sub.Filters {
 				if models.MatchesFilter(event, filter) {
-					response := []interface{}{"EVENT", subID, event}
+					outgoing := relay.applyOverwriteResponseEvent(client, event)
+					response := []interface{}{"EVENT", sub.ID, outgoing}
 					jsonResponse, err := json.Marshal(response)
 					if err != nil {
 						log.Println("Error marshaling event:", err)
 						continue
 					}
 
-					client.conn.WriteMessage(websocket.TextMessage, jsonResponse)
+					client.enqueue(jsonResponse)
 					break // Send once per subscription
 				}
 			}
@@ -132,6 +247,9 @@ func (relay *Relay) handleMessage(client *Client, message []byte) error {
 	case "CLOSE":
 		return relay.handleCloseMessage(client, rawMessage)
 
+	case "AUTH":
+		return relay.handleAuthMessage(client, rawMessage)
+
 	default:
 		return fmt.Errorf("unknown message type: %s", messageType)
 	}
@@ -148,27 +266,70 @@ func (relay *Relay) handleEventMessage(client *Client, rawMessage []json.RawMess
 		return fmt.Errorf("invalid event data: %v", err)
 	}
 
+	if relay.RequireAuthForWrite && !client.Authenticated() {
+		return relay.sendOK(client, event.ID, false, "auth-required: this relay requires NIP-42 authentication for writes")
+	}
+
 	// Validate event
 	if !models.ValidateEvent(&event) {
 		return fmt.Errorf("invalid event: ID or signature verification failed")
 	}
 
-	// Store event
-	if relay.eventStore.Add(&event) {
-		// Broadcast to clients with matching subscriptions
+	if relay.eventStore.IsDeleted(event.ID) {
+		return relay.sendOK(client, event.ID, false, "blocked: deleted")
+	}
+
+	if reject, msg := relay.runRejectEvent(client, &event); reject {
+		return relay.sendOK(client, event.ID, false, msg)
+	}
+
+	switch {
+	case event.Kind == models.KindDeletion:
+		return relay.handleDeletionEvent(client, &event)
+
+	case models.IsEphemeralKind(event.Kind):
+		// Ephemeral events are broadcast but never stored, per NIP-16.
 		relay.BroadcastEvent(&event)
+		return relay.sendOK(client, event.ID, true, "")
 
-		// Send OK message back to client
-		okResponse := []interface{}{"OK", event.ID, true, ""}
-		jsonOkResponse, err := json.Marshal(okResponse)
-		if err != nil {
-			log.Println("Error marshaling OK response:", err)
-			return nil
+	case models.IsReplaceableKind(event.Kind), models.IsParameterizedReplaceableKind(event.Kind):
+		if !relay.applyReplaceableSemantics(&event) {
+			return relay.sendOK(client, event.ID, false, "blocked: a newer replacement event already exists")
+		}
+		fallthrough
+
+	default:
+		// Store event
+		if relay.eventStore.Add(&event) {
+			// Broadcast to clients with matching subscriptions
+			relay.BroadcastEvent(&event)
+
+			return relay.sendOK(client, event.ID, true, "")
 		}
+	}
+
+	return nil
+}
 
-		client.conn.WriteMessage(websocket.TextMessage, jsonOkResponse)
+// sendOK queues a NIP-01 ["OK", id, ok, message] response to a client.
+func (relay *Relay) sendOK(client *Client, id string, ok bool, message string) error {
+	okResponse := []interface{}{"OK", id, ok, message}
+	jsonOkResponse, err := json.Marshal(okResponse)
+	if err != nil {
+		return fmt.Errorf("error marshaling OK response: %v", err)
 	}
+	client.enqueue(jsonOkResponse)
+	return nil
+}
 
+// sendClosed queues a NIP-01 ["CLOSED", subID, message] response to a client.
+func (relay *Relay) sendClosed(client *Client, subID string, message string) error {
+	closedResponse := []interface{}{"CLOSED", subID, message}
+	jsonClosedResponse, err := json.Marshal(closedResponse)
+	if err != nil {
+		return fmt.Errorf("error marshaling CLOSED response: %v", err)
+	}
+	client.enqueue(jsonClosedResponse)
 	return nil
 }
 
@@ -183,6 +344,10 @@ func (relay *Relay) handleReqMessage(client *Client, rawMessage []json.RawMessag
 		return fmt.Errorf("invalid subscription ID: %v", err)
 	}
 
+	if relay.RequireAuthForRead && !client.Authenticated() {
+		return relay.sendClosed(client, subscriptionID, "auth-required: this relay requires NIP-42 authentication for reads")
+	}
+
 	// Cancel previous subscription with this ID if it exists
 	client.RemoveSubscription(subscriptionID)
 
@@ -194,16 +359,29 @@ func (relay *Relay) handleReqMessage(client *Client, rawMessage []json.RawMessag
 			return fmt.Errorf("invalid filter: %v", err)
 		}
 
+		if reject, msg := relay.runRejectFilter(client, &filter); reject {
+			return relay.sendClosed(client, subscriptionID, msg)
+		}
+
 		filters = append(filters, filter)
 	}
 
 	// Create new subscription
 	client.AddSubscription(subscriptionID, filters)
 
-	// Send matching events immediately
+	// Send matching events immediately, newest first and truncated to the
+	// filter's limit, as NIP-01 requires
 	for _, filter := range filters {
 		events := relay.eventStore.Query(filter)
+		sort.Slice(events, func(i, j int) bool {
+			return events[i].CreatedAt > events[j].CreatedAt
+		})
+		if filter.Limit > 0 && len(events) > filter.Limit {
+			events = events[:filter.Limit]
+		}
+
 		for _, event := range events {
+			event := relay.applyOverwriteResponseEvent(client, event)
 			response := []interface{}{"EVENT", subscriptionID, event}
 			jsonResponse, err := json.Marshal(response)
 			if err != nil {
@@ -211,7 +389,7 @@ func (relay *Relay) handleReqMessage(client *Client, rawMessage []json.RawMessag
 				continue
 			}
 
-			client.conn.WriteMessage(websocket.TextMessage, jsonResponse)
+			client.enqueue(jsonResponse)
 		}
 	}
 
@@ -223,7 +401,7 @@ func (relay *Relay) handleReqMessage(client *Client, rawMessage []json.RawMessag
 		return nil
 	}
 
-	client.conn.WriteMessage(websocket.TextMessage, jsonEoseResponse)
+	client.enqueue(jsonEoseResponse)
 
 	return nil
 }
@@ -0,0 +1,336 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+
+	_ "modernc.org/sqlite"
+
+	"cosanostra/pkg/models"
+)
+
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS events (
+	id         TEXT PRIMARY KEY,
+	pubkey     TEXT NOT NULL,
+	kind       INTEGER NOT NULL,
+	created_at INTEGER NOT NULL,
+	content    TEXT NOT NULL,
+	sig        TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_events_pubkey ON events(pubkey);
+CREATE INDEX IF NOT EXISTS idx_events_kind ON events(kind);
+CREATE INDEX IF NOT EXISTS idx_events_created_at ON events(created_at DESC);
+
+CREATE TABLE IF NOT EXISTS tags (
+	event_id  TEXT NOT NULL,
+	tag_name  TEXT NOT NULL,
+	tag_value TEXT NOT NULL,
+	position  INTEGER NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_tags_name_value ON tags(tag_name, tag_value);
+CREATE INDEX IF NOT EXISTS idx_tags_event_id ON tags(event_id);
+
+CREATE TABLE IF NOT EXISTS deletions (
+	id TEXT PRIMARY KEY
+);
+`
+
+// SQLiteStore is a Storage backend that persists events to a SQLite
+// database file, with indexes matching the filters clients actually send.
+type SQLiteStore struct {
+	db *sql.DB
+}
+
+var _ Storage = (*SQLiteStore)(nil)
+
+// NewSQLiteStore opens (creating if necessary) a SQLite database at path
+// and migrates it to the current schema.
+func NewSQLiteStore(path string) (*SQLiteStore, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open sqlite database: %v", err)
+	}
+
+	// The driver doesn't support concurrent writers on one connection pool.
+	db.SetMaxOpenConns(1)
+
+	store := &SQLiteStore{db: db}
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to migrate sqlite schema: %v", err)
+	}
+
+	return store, nil
+}
+
+// Add stores an event and its tags, returning false if an event with the
+// same ID already exists. Only the first two elements (name and value) of
+// each tag are stored; tags with fewer than two elements are not stored.
+func (store *SQLiteStore) Add(event *models.Event) bool {
+	tx, err := store.db.Begin()
+	if err != nil {
+		return false
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(
+		`INSERT OR IGNORE INTO events (id, pubkey, kind, created_at, content, sig) VALUES (?, ?, ?, ?, ?, ?)`,
+		event.ID, event.PubKey, event.Kind, event.CreatedAt, event.Content, event.Sig,
+	)
+	if err != nil {
+		return false
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil || rows == 0 {
+		return false
+	}
+
+	for position, tag := range event.Tags {
+		if len(tag) < 2 {
+			continue
+		}
+		if _, err := tx.Exec(
+			`INSERT INTO tags (event_id, tag_name, tag_value, position) VALUES (?, ?, ?, ?)`,
+			event.ID, tag[0], tag[1], position,
+		); err != nil {
+			return false
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false
+	}
+
+	return true
+}
+
+// GetByID retrieves a single event by its ID.
+func (store *SQLiteStore) GetByID(id string) (*models.Event, bool) {
+	event := &models.Event{}
+	err := store.db.QueryRow(
+		`SELECT id, pubkey, kind, created_at, content, sig FROM events WHERE id = ?`, id,
+	).Scan(&event.ID, &event.PubKey, &event.Kind, &event.CreatedAt, &event.Content, &event.Sig)
+	if err != nil {
+		return nil, false
+	}
+
+	if err := store.attachTags([]*models.Event{event}); err != nil {
+		return nil, false
+	}
+
+	return event, true
+}
+
+// Delete removes an event and its tags by ID, returning false if it didn't
+// exist.
+func (store *SQLiteStore) Delete(id string) bool {
+	result, err := store.db.Exec(`DELETE FROM events WHERE id = ?`, id)
+	if err != nil {
+		return false
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil || rows == 0 {
+		return false
+	}
+
+	store.db.Exec(`DELETE FROM tags WHERE event_id = ?`, id)
+	return true
+}
+
+// IsDeleted reports whether id was deleted via a NIP-09 deletion request.
+func (store *SQLiteStore) IsDeleted(id string) bool {
+	var exists int
+	err := store.db.QueryRow(`SELECT 1 FROM deletions WHERE id = ?`, id).Scan(&exists)
+	return err == nil
+}
+
+// MarkDeleted records that id was deleted via a NIP-09 deletion request.
+func (store *SQLiteStore) MarkDeleted(id string) {
+	store.db.Exec(`INSERT OR IGNORE INTO deletions (id) VALUES (?)`, id)
+}
+
+// Query returns events matching filter, newest first, limited server-side
+// when filter.Limit is set.
+func (store *SQLiteStore) Query(filter models.Filter) []*models.Event {
+	query, args := buildFilterQuery("SELECT DISTINCT events.id, events.pubkey, events.kind, events.created_at, events.content, events.sig FROM events", filter)
+
+	rows, err := store.db.Query(query, args...)
+	if err != nil {
+		return nil
+	}
+
+	var results []*models.Event
+	for rows.Next() {
+		event := &models.Event{}
+		if err := rows.Scan(&event.ID, &event.PubKey, &event.Kind, &event.CreatedAt, &event.Content, &event.Sig); err != nil {
+			continue
+		}
+		results = append(results, event)
+	}
+	rows.Close()
+
+	// Tags are fetched in a single batched query after the cursor above is
+	// closed - db is a single-connection pool, so a nested query issued
+	// while rows is still open would deadlock waiting for that connection.
+	if err := store.attachTags(results); err != nil {
+		return nil
+	}
+
+	return results
+}
+
+// CountByFilter returns how many stored events match filter, without
+// fetching them.
+func (store *SQLiteStore) CountByFilter(filter models.Filter) int {
+	query, args := buildFilterQuery("SELECT COUNT(DISTINCT events.id) FROM events", filter)
+
+	var count int
+	if err := store.db.QueryRow(query, args...).Scan(&count); err != nil {
+		return 0
+	}
+
+	return count
+}
+
+// attachTags loads every tag row for the given events in one query and
+// populates each event's Tags field, preserving the stored position order.
+// Callers must not hold any other *sql.Rows open on store.db - with the
+// single-connection pool, doing so would deadlock waiting for a connection
+// that the open cursor is holding.
+func (store *SQLiteStore) attachTags(events []*models.Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	byID := make(map[string]*models.Event, len(events))
+	placeholders := make([]string, len(events))
+	args := make([]interface{}, len(events))
+	for i, event := range events {
+		byID[event.ID] = event
+		placeholders[i] = "?"
+		args[i] = event.ID
+	}
+
+	query := fmt.Sprintf(
+		`SELECT event_id, tag_name, tag_value FROM tags WHERE event_id IN (%s) ORDER BY event_id, position`,
+		strings.Join(placeholders, ", "),
+	)
+
+	rows, err := store.db.Query(query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var eventID, name, value string
+		if err := rows.Scan(&eventID, &name, &value); err != nil {
+			return err
+		}
+		if event, ok := byID[eventID]; ok {
+			event.Tags = append(event.Tags, []string{name, value})
+		}
+	}
+
+	return rows.Err()
+}
+
+// buildFilterQuery translates a models.Filter into a SQL WHERE clause
+// appended to base, along with its bound arguments.
+func buildFilterQuery(base string, filter models.Filter) (string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+
+	// ids/authors support NIP-01 prefix matching, so we can't use a plain IN
+	// (...) - each value is matched as a LIKE prefix instead.
+	if len(filter.IDs) > 0 {
+		var idConditions []string
+		for _, id := range filter.IDs {
+			idConditions = append(idConditions, "events.id LIKE ?")
+			args = append(args, id+"%")
+		}
+		conditions = append(conditions, "("+strings.Join(idConditions, " OR ")+")")
+	}
+
+	if len(filter.Authors) > 0 {
+		var authorConditions []string
+		for _, author := range filter.Authors {
+			authorConditions = append(authorConditions, "events.pubkey LIKE ?")
+			args = append(args, author+"%")
+		}
+		conditions = append(conditions, "("+strings.Join(authorConditions, " OR ")+")")
+	}
+
+	if len(filter.Kinds) > 0 {
+		placeholders := make([]string, len(filter.Kinds))
+		for i, kind := range filter.Kinds {
+			placeholders[i] = "?"
+			args = append(args, kind)
+		}
+		conditions = append(conditions, fmt.Sprintf("events.kind IN (%s)", strings.Join(placeholders, ", ")))
+	}
+
+	if filter.Since > 0 {
+		conditions = append(conditions, "events.created_at >= ?")
+		args = append(args, filter.Since)
+	}
+
+	if filter.Until > 0 {
+		conditions = append(conditions, "events.created_at <= ?")
+		args = append(args, filter.Until)
+	}
+
+	if filter.Search != "" {
+		conditions = append(conditions, "events.content LIKE ?")
+		args = append(args, "%"+filter.Search+"%")
+	}
+
+	// Each "#<letter>" tag filter becomes its own sub-select against the
+	// tags index; AND-ing them together intersects the filters the way
+	// NIP-01 requires when several are present in one filter object.
+	tagNames := make([]string, 0, len(filter.Tags))
+	for tagName := range filter.Tags {
+		tagNames = append(tagNames, tagName)
+	}
+	sort.Strings(tagNames)
+
+	for _, tagName := range tagNames {
+		values := filter.Tags[tagName]
+		placeholders := make([]string, len(values))
+		subArgs := make([]interface{}, 0, len(values)+1)
+		subArgs = append(subArgs, tagName)
+		for i, value := range values {
+			placeholders[i] = "?"
+			subArgs = append(subArgs, value)
+		}
+		conditions = append(conditions, fmt.Sprintf(
+			"events.id IN (SELECT event_id FROM tags WHERE tag_name = ? AND tag_value IN (%s))",
+			strings.Join(placeholders, ", "),
+		))
+		args = append(args, subArgs...)
+	}
+
+	query := base
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	if strings.HasPrefix(base, "SELECT COUNT") {
+		return query, args
+	}
+
+	query += " ORDER BY events.created_at DESC"
+	if filter.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, filter.Limit)
+	}
+
+	return query, args
+}
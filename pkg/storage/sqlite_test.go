@@ -0,0 +1,96 @@
+package storage
+
+import (
+	"testing"
+
+	"cosanostra/pkg/models"
+)
+
+func newTestStore(t *testing.T) *SQLiteStore {
+	t.Helper()
+	store, err := NewSQLiteStore(":memory:")
+	if err != nil {
+		t.Fatalf("NewSQLiteStore: %v", err)
+	}
+	t.Cleanup(func() { store.db.Close() })
+	return store
+}
+
+func mustAdd(t *testing.T, store *SQLiteStore, event *models.Event) {
+	t.Helper()
+	if !store.Add(event) {
+		t.Fatalf("Add(%s) = false, want true", event.ID)
+	}
+}
+
+func TestSQLiteQueryTagFilterIntersection(t *testing.T) {
+	store := newTestStore(t)
+
+	mustAdd(t, store, &models.Event{
+		ID: "event-both", PubKey: "alice", Kind: 1, CreatedAt: 100,
+		Tags: [][]string{{"e", "root"}, {"p", "bob"}},
+	})
+	mustAdd(t, store, &models.Event{
+		ID: "event-e-only", PubKey: "alice", Kind: 1, CreatedAt: 101,
+		Tags: [][]string{{"e", "root"}},
+	})
+	mustAdd(t, store, &models.Event{
+		ID: "event-p-only", PubKey: "alice", Kind: 1, CreatedAt: 102,
+		Tags: [][]string{{"p", "bob"}},
+	})
+
+	results := store.Query(models.Filter{
+		Tags: map[string][]string{
+			"e": {"root"},
+			"p": {"bob"},
+		},
+	})
+
+	if len(results) != 1 || results[0].ID != "event-both" {
+		t.Fatalf("Query with intersecting tag filters = %v, want only event-both", idsOf(results))
+	}
+}
+
+func TestSQLiteQueryPrefixMatch(t *testing.T) {
+	store := newTestStore(t)
+
+	mustAdd(t, store, &models.Event{ID: "deadbeef01", PubKey: "aaaa1111", Kind: 1, CreatedAt: 100})
+	mustAdd(t, store, &models.Event{ID: "deadbeef02", PubKey: "bbbb2222", Kind: 1, CreatedAt: 101})
+	mustAdd(t, store, &models.Event{ID: "cafef00d01", PubKey: "cccc3333", Kind: 1, CreatedAt: 102})
+
+	results := store.Query(models.Filter{IDs: []string{"deadbeef"}})
+	if len(results) != 2 {
+		t.Fatalf("Query with id prefix = %v, want 2 results", idsOf(results))
+	}
+
+	results = store.Query(models.Filter{Authors: []string{"aaaa"}})
+	if len(results) != 1 || results[0].ID != "deadbeef01" {
+		t.Fatalf("Query with author prefix = %v, want only deadbeef01", idsOf(results))
+	}
+}
+
+func TestSQLiteQueryLimitSinceUntil(t *testing.T) {
+	store := newTestStore(t)
+
+	mustAdd(t, store, &models.Event{ID: "e1", PubKey: "alice", Kind: 1, CreatedAt: 100})
+	mustAdd(t, store, &models.Event{ID: "e2", PubKey: "alice", Kind: 1, CreatedAt: 200})
+	mustAdd(t, store, &models.Event{ID: "e3", PubKey: "alice", Kind: 1, CreatedAt: 300})
+	mustAdd(t, store, &models.Event{ID: "e4", PubKey: "alice", Kind: 1, CreatedAt: 400})
+
+	results := store.Query(models.Filter{Since: 150, Until: 350, Limit: 1})
+	if len(results) != 1 || results[0].ID != "e3" {
+		t.Fatalf("Query with since/until/limit = %v, want only e3 (newest within range)", idsOf(results))
+	}
+
+	if count := store.CountByFilter(models.Filter{Since: 150, Until: 350}); count != 2 {
+		t.Fatalf("CountByFilter with since/until = %d, want 2", count)
+	}
+}
+
+func idsOf(events []*models.Event) []string {
+	ids := make([]string, len(events))
+	for i, e := range events {
+		ids[i] = e.ID
+	}
+	return ids
+}
@@ -0,0 +1,54 @@
+package storage
+
+import (
+	"fmt"
+
+	"cosanostra/pkg/models"
+)
+
+// Storage is the pluggable persistence backend for events. EventStore (the
+// in-memory map) and SQLiteStore both implement it, so the relay can run
+// against either without any code changes elsewhere.
+type Storage interface {
+	// Add stores an event, returning false if an event with the same ID
+	// already exists.
+	Add(event *models.Event) bool
+	// Query returns events matching filter. The order depends on the
+	// backend: SQLiteStore returns them newest first, EventStore in no
+	// defined order.
+	Query(filter models.Filter) []*models.Event
+	// GetByID retrieves a single event by its ID.
+	GetByID(id string) (*models.Event, bool)
+	// Delete removes an event by its ID, returning false if it didn't exist.
+	Delete(id string) bool
+	// CountByFilter returns how many stored events match filter, without
+	// fetching them.
+	CountByFilter(filter models.Filter) int
+
+	// IsDeleted reports whether an event ID was deleted via a NIP-09
+	// deletion request, which blocks it from ever being re-accepted.
+	IsDeleted(id string) bool
+	// MarkDeleted records that an event ID was deleted via a NIP-09
+	// deletion request.
+	MarkDeleted(id string)
+}
+
+// Config selects and configures the storage backend used by the relay.
+type Config struct {
+	// Backend is "memory" (the default) or "sqlite".
+	Backend string
+	// SQLitePath is the database file path, used when Backend is "sqlite".
+	SQLitePath string
+}
+
+// New constructs the Storage backend described by cfg.
+func New(cfg Config) (Storage, error) {
+	switch cfg.Backend {
+	case "", "memory":
+		return NewEventStore(), nil
+	case "sqlite":
+		return NewSQLiteStore(cfg.SQLitePath)
+	default:
+		return nil, fmt.Errorf("unknown storage backend: %q", cfg.Backend)
+	}
+}
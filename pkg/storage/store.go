@@ -8,14 +8,18 @@ import (
 
 // EventStore manages events in memory
 type EventStore struct {
-	events map[string]*models.Event
-	mutex  sync.RWMutex
+	events    map[string]*models.Event
+	deletions map[string]bool
+	mutex     sync.RWMutex
 }
 
+var _ Storage = (*EventStore)(nil)
+
 // NewEventStore creates a new event store
 func NewEventStore() *EventStore {
 	return &EventStore{
-		events: make(map[string]*models.Event),
+		events:    make(map[string]*models.Event),
+		deletions: make(map[string]bool),
 	}
 }
 
@@ -57,3 +61,47 @@ func (store *EventStore) GetByID(id string) (*models.Event, bool) {
 	event, exists := store.events[id]
 	return event, exists
 }
+
+// Delete removes an event by its ID
+func (store *EventStore) Delete(id string) bool {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if _, exists := store.events[id]; !exists {
+		return false
+	}
+
+	delete(store.events, id)
+	return true
+}
+
+// CountByFilter returns how many stored events match filter
+func (store *EventStore) CountByFilter(filter models.Filter) int {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	count := 0
+	for _, event := range store.events {
+		if models.MatchesFilter(event, filter) {
+			count++
+		}
+	}
+
+	return count
+}
+
+// IsDeleted reports whether id was deleted via a NIP-09 deletion request
+func (store *EventStore) IsDeleted(id string) bool {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	return store.deletions[id]
+}
+
+// MarkDeleted records that id was deleted via a NIP-09 deletion request
+func (store *EventStore) MarkDeleted(id string) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	store.deletions[id] = true
+}